@@ -0,0 +1,129 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+type pcapWriter struct {
+	w         io.Writer
+	byteOrder binary.ByteOrder
+}
+
+func newPcapWriter(w io.Writer, linkType LinkType) (Writer, error) {
+	pw := &pcapWriter{w: w, byteOrder: binary.LittleEndian}
+
+	hdr := pcapFileHeader{
+		Magic:        pcapMagicMicro,
+		VersionMajor: 2,
+		VersionMinor: 4,
+		ThisZone:     0,
+		SigFigs:      0,
+		SnapLen:      1 << 16,
+		LinkType:     uint32(linkType),
+	}
+	if err := binary.Write(pw.w, pw.byteOrder, hdr); err != nil {
+		return nil, fmt.Errorf("pcap: writing file header: %w", err)
+	}
+
+	return pw, nil
+}
+
+func (pw *pcapWriter) WriteFrame(f Frame) error {
+	rec := pcapRecordHeader{
+		TsSec:   uint32(f.Timestamp.Unix()),
+		TsUsec:  uint32(f.Timestamp.Nanosecond() / 1000),
+		InclLen: uint32(len(f.Data)),
+		OrigLen: uint32(len(f.Data)),
+	}
+	if err := binary.Write(pw.w, pw.byteOrder, rec); err != nil {
+		return fmt.Errorf("pcap: writing record header: %w", err)
+	}
+	if _, err := pw.w.Write(f.Data); err != nil {
+		return fmt.Errorf("pcap: writing record data: %w", err)
+	}
+	return nil
+}
+
+func (pw *pcapWriter) Close() error { return nil }
+
+type pcapReader struct {
+	r         io.Reader
+	byteOrder binary.ByteOrder
+	nanos     bool
+	snapLen   uint32
+}
+
+func newPcapReader(r io.Reader) (Reader, error) {
+	var hdr pcapFileHeader
+
+	// Peek the magic number to pick a byte order, then read the full
+	// header with that order applied.
+	magicBytes := make([]byte, 4)
+	if _, err := io.ReadFull(r, magicBytes); err != nil {
+		return nil, fmt.Errorf("pcap: reading file header: %w", err)
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	magic := order.Uint32(magicBytes)
+	if magic != pcapMagicMicro && magic != pcapMagicNanos {
+		order = binary.BigEndian
+		magic = order.Uint32(magicBytes)
+	}
+	if magic != pcapMagicMicro && magic != pcapMagicNanos {
+		return nil, fmt.Errorf("pcap: not a pcap capture (magic % x)", magicBytes)
+	}
+
+	rest := make([]byte, 20)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, fmt.Errorf("pcap: reading file header: %w", err)
+	}
+	hdr.Magic = magic
+	hdr.VersionMajor = order.Uint16(rest[0:2])
+	hdr.VersionMinor = order.Uint16(rest[2:4])
+	hdr.ThisZone = int32(order.Uint32(rest[4:8]))
+	hdr.SigFigs = order.Uint32(rest[8:12])
+	hdr.SnapLen = order.Uint32(rest[12:16])
+	hdr.LinkType = order.Uint32(rest[16:20])
+
+	return &pcapReader{r: r, byteOrder: order, nanos: magic == pcapMagicNanos, snapLen: hdr.SnapLen}, nil
+}
+
+func (pr *pcapReader) ReadFrame() (Frame, error) {
+	recBytes := make([]byte, 16)
+	if _, err := io.ReadFull(pr.r, recBytes); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return Frame{}, err
+	}
+
+	tsSec := pr.byteOrder.Uint32(recBytes[0:4])
+	tsFrac := pr.byteOrder.Uint32(recBytes[4:8])
+	inclLen := pr.byteOrder.Uint32(recBytes[8:12])
+
+	limit := uint32(maxFrameLen)
+	if pr.snapLen != 0 && pr.snapLen < limit {
+		limit = pr.snapLen
+	}
+	if inclLen > limit {
+		return Frame{}, fmt.Errorf("pcap: record length %d exceeds snaplen %d", inclLen, limit)
+	}
+
+	data := make([]byte, inclLen)
+	if _, err := io.ReadFull(pr.r, data); err != nil {
+		return Frame{}, fmt.Errorf("pcap: reading record data: %w", err)
+	}
+
+	nanos := int64(tsFrac) * 1000
+	if pr.nanos {
+		nanos = int64(tsFrac)
+	}
+
+	return Frame{
+		Timestamp: time.Unix(int64(tsSec), nanos),
+		Data:      data,
+	}, nil
+}
@@ -0,0 +1,113 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+)
+
+// TestWriteReadRoundTrip writes a handful of frames to a buffer in each
+// container format and checks ReadFrame plays them back in order with the
+// same data.
+func TestWriteReadRoundTrip(t *testing.T) {
+	frames := []Frame{
+		{Timestamp: time.Unix(1700000000, 0), Data: []byte{0xde, 0xad, 0xbe, 0xef}},
+		{Timestamp: time.Unix(1700000001, 500000000), Data: []byte{0x00, 0x01, 0x02}},
+	}
+
+	for _, format := range []Format{FormatPcap, FormatPcapNG} {
+		format := format
+		t.Run(formatName(format), func(t *testing.T) {
+			var buf bytes.Buffer
+
+			w, err := NewWriter(&buf, format, LinkTypeUSER0)
+			if err != nil {
+				t.Fatalf("NewWriter: %v", err)
+			}
+			for i, f := range frames {
+				if err := w.WriteFrame(f); err != nil {
+					t.Fatalf("WriteFrame %d: %v", i, err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			r, err := NewReader(&buf)
+			if err != nil {
+				t.Fatalf("NewReader: %v", err)
+			}
+
+			for i, want := range frames {
+				got, err := r.ReadFrame()
+				if err != nil {
+					t.Fatalf("ReadFrame %d: %v", i, err)
+				}
+				if !bytes.Equal(got.Data, want.Data) {
+					t.Fatalf("frame %d: data = % x, want % x", i, got.Data, want.Data)
+				}
+				if got.Timestamp.Unix() != want.Timestamp.Unix() {
+					t.Fatalf("frame %d: timestamp = %v, want %v", i, got.Timestamp, want.Timestamp)
+				}
+			}
+
+			if _, err := r.ReadFrame(); err != io.EOF {
+				t.Fatalf("ReadFrame after last frame: err = %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+// TestReadFrameRejectsOversizedLength checks that ReadFrame refuses to
+// allocate for a record/block whose file-controlled length field claims
+// more than the format's bound allows, instead of trusting it outright.
+func TestReadFrameRejectsOversizedLength(t *testing.T) {
+	t.Run("pcap exceeds snaplen", func(t *testing.T) {
+		var buf bytes.Buffer
+		hdr := pcapFileHeader{
+			Magic:        pcapMagicMicro,
+			VersionMajor: 2,
+			VersionMinor: 4,
+			SnapLen:      16,
+			LinkType:     uint32(LinkTypeUSER0),
+		}
+		if err := binary.Write(&buf, binary.LittleEndian, hdr); err != nil {
+			t.Fatalf("writing file header: %v", err)
+		}
+		rec := pcapRecordHeader{InclLen: 1000, OrigLen: 1000}
+		if err := binary.Write(&buf, binary.LittleEndian, rec); err != nil {
+			t.Fatalf("writing record header: %v", err)
+		}
+
+		r, err := NewReader(&buf)
+		if err != nil {
+			t.Fatalf("NewReader: %v", err)
+		}
+		if _, err := r.ReadFrame(); err == nil {
+			t.Fatal("ReadFrame: want error for a record exceeding snaplen, got nil")
+		}
+	})
+
+	t.Run("pcapng exceeds max", func(t *testing.T) {
+		var buf bytes.Buffer
+		buf.Write(le32(ngBlockEPB))
+		buf.Write(le32(uint32(12 + maxFrameLen + 1)))
+
+		r, err := newNgReader(&buf)
+		if err != nil {
+			t.Fatalf("newNgReader: %v", err)
+		}
+		if _, err := r.ReadFrame(); err == nil {
+			t.Fatal("ReadFrame: want error for a block exceeding maxFrameLen, got nil")
+		}
+	})
+}
+
+func formatName(f Format) string {
+	if f == FormatPcapNG {
+		return "pcapng"
+	}
+	return "pcap"
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/rabidcicada/go-pcie-tlp/pcie"
+)
+
+// DecodedTLP is the structured result of decoding a single raw TLP. It is
+// what the --output formatters serialize, so every field is tagged for both
+// JSON and YAML.
+type DecodedTLP struct {
+	Type      string                 `json:"type" yaml:"type"`
+	Timestamp *time.Time             `json:"timestamp,omitempty" yaml:"timestamp,omitempty"`
+	Prefixes  []DecodedPrefix        `json:"prefixes,omitempty" yaml:"prefixes,omitempty"`
+	Fields    map[string]interface{} `json:"fields" yaml:"fields"`
+	Payload   string                 `json:"payload,omitempty" yaml:"payload,omitempty"`
+	RawBytes  string                 `json:"raw_bytes" yaml:"raw_bytes"`
+}
+
+// decodeTLP walks any TLP prefix chain off the front of raw, then tries
+// each candidate type in turn against what's left, first match wins. It
+// returns a typed DecodedTLP instead of printing so the output layer can render it as
+// text, JSON, or YAML. errs carries one error per type that failed to
+// parse; it is non-nil even on success if earlier candidates failed.
+func decodeTLP(raw []byte, types []string) (*DecodedTLP, []error) {
+	prefixes, body, err := decodePrefixChain(raw)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	var errs []error
+
+	for _, t := range types {
+		fields, payload, tlpBytes, err := decodeFields(t, body)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t, err))
+			continue
+		}
+
+		return &DecodedTLP{
+			Type:     t,
+			Prefixes: prefixes,
+			Fields:   fields,
+			Payload:  payload,
+			RawBytes: hex.EncodeToString(tlpBytes),
+		}, errs
+	}
+
+	return nil, errs
+}
+
+// decodeTlpHeaderDword parses the first header dword, common to every TLP,
+// the same way pcie.TlpHeader.fromBuffer does (PCI Express Base Spec
+// §2.2.1, Figure 2-3). The pcie package keeps that parser unexported, so
+// this hand-rolls it from the public bit layout, the same way prefix.go
+// hand-rolls prefix dwords the library doesn't model at all.
+func decodeTlpHeaderDword(dw []byte) pcie.TlpHeader {
+	return pcie.TlpHeader{
+		Type:   pcie.TlpType(dw[0]),
+		TC:     pcie.TrafficClass((dw[1] >> 4) & 0x7),
+		IBO:    dw[1]&0x04 != 0,
+		LN:     dw[1]&0x02 != 0,
+		TH:     dw[1]&0x01 != 0,
+		TD:     dw[2]&0x80 != 0,
+		EP:     dw[2]&0x40 != 0,
+		RO:     dw[2]&0x20 != 0,
+		NS:     dw[2]&0x10 != 0,
+		AT:     pcie.AddressType((dw[2] >> 2) & 0x3),
+		Length: int(dw[2]&0x3)<<8 | int(dw[3]),
+	}
+}
+
+// decodeRequestHeader parses the first two header dwords shared by every
+// Memory, IO, and Config request TLP (pcie.RequestHeader's wire layout,
+// PCI Express Base Spec §2.2.1). body must be at least 8 bytes.
+func decodeRequestHeader(body []byte) pcie.RequestHeader {
+	return pcie.RequestHeader{
+		TlpHeader: decodeTlpHeaderDword(body[0:4]),
+		ReqID:     pcie.NewDeviceID(binary.BigEndian.Uint16(body[4:6])),
+		Tag:       body[6],
+		FirstBE:   body[7] & 0xf,
+		LastBE:    (body[7] >> 4) & 0xf,
+	}
+}
+
+// decodeFields parses body as TLP type t and returns its header fields, its
+// payload (if any) hex-encoded, and the canonical bytes ToBytes produced.
+//
+// The pcie package only exposes a FromBytes parser for MRd, MWr, Cpl (which
+// covers both CplE and CplD), and CfgWr; CfgRd, IORd, IOWrt, and
+// CplLk/CplLkD (CPLLK) are hand-decoded below from the same public header
+// layout buildTLP's constructors already populate.
+func decodeFields(t string, body []byte) (map[string]interface{}, string, []byte, error) {
+	switch t {
+	case "MEMRD":
+		tlp, err := pcie.NewMRdFromBytes(body)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return map[string]interface{}{
+			"requester_id": fmt.Sprintf("0x%04x", tlp.ReqID.ToUint16()),
+			"tag":          tlp.Tag,
+			"address":      fmt.Sprintf("0x%x", tlp.Address),
+			"length":       tlp.DataLength(),
+			"first_be":     fmt.Sprintf("0x%01x", tlp.FirstBE),
+			"last_be":      fmt.Sprintf("0x%01x", tlp.LastBE),
+			"tc":           tlp.TC,
+			"ns":           tlp.NS,
+			"ro":           tlp.RO,
+		}, "", tlp.ToBytes(), nil
+	case "MEMWR":
+		tlp, err := pcie.NewMWrFromBytes(body)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return map[string]interface{}{
+			"requester_id": fmt.Sprintf("0x%04x", tlp.ReqID.ToUint16()),
+			"tag":          tlp.Tag,
+			"address":      fmt.Sprintf("0x%x", tlp.Address),
+			"length":       tlp.DataLength(),
+			"first_be":     fmt.Sprintf("0x%01x", tlp.FirstBE),
+			"last_be":      fmt.Sprintf("0x%01x", tlp.LastBE),
+			"tc":           tlp.TC,
+			"ns":           tlp.NS,
+			"ro":           tlp.RO,
+		}, hex.EncodeToString(tlp.Data), tlp.ToBytes(), nil
+	case "CPL":
+		tlp, err := pcie.NewCplFromBytes(body)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return map[string]interface{}{
+			"completer_id":  fmt.Sprintf("0x%04x", tlp.CplID.ToUint16()),
+			"status":        tlp.Status,
+			"requester_id":  fmt.Sprintf("0x%04x", tlp.ReqID.ToUint16()),
+			"tag":           tlp.Tag,
+			"byte_count":    tlp.BC,
+			"lower_address": fmt.Sprintf("0x%02x", tlp.AddressLow),
+			"tc":            tlp.TC,
+		}, hex.EncodeToString(tlp.Data), tlp.ToBytes(), nil
+	case "CFGWR":
+		tlp, err := pcie.NewCfgWrFromBytes(body)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return map[string]interface{}{
+			"requester_id": fmt.Sprintf("0x%04x", tlp.ReqID.ToUint16()),
+			"tag":          tlp.Tag,
+			"register_num": fmt.Sprintf("0x%03x", tlp.RegisterNumber),
+			"ext_reg_num":  fmt.Sprintf("0x%01x", tlp.ExtRegisterNumber),
+		}, hex.EncodeToString(tlp.Data), tlp.ToBytes(), nil
+	case "CFGRD":
+		if len(body) < 3*4 {
+			return nil, "", nil, fmt.Errorf("%w: TLP buffer too short (%d), expected at least 12 bytes", pcie.ErrTooShort, len(body))
+		}
+		reqHdr := decodeRequestHeader(body)
+		if reqHdr.Type != pcie.CfgRd0 && reqHdr.Type != pcie.CfgRd1 {
+			return nil, "", nil, fmt.Errorf("%w: type %x is not supported. supported types: CfgRd0, CfgRd1", pcie.ErrBadType, reqHdr.Type)
+		}
+		tlp := &pcie.CfgRd{CfgHeader: pcie.CfgHeader{
+			RequestHeader:     reqHdr,
+			Target:            pcie.NewDeviceID(binary.BigEndian.Uint16(body[8:10])),
+			ExtRegisterNumber: int(body[10] & 0xf),
+			RegisterNumber:    int(body[11]>>2) & 0x3f,
+		}}
+		return map[string]interface{}{
+			"requester_id": fmt.Sprintf("0x%04x", tlp.ReqID.ToUint16()),
+			"tag":          tlp.Tag,
+			"target_id":    fmt.Sprintf("0x%04x", tlp.Target.ToUint16()),
+			"register_num": fmt.Sprintf("0x%03x", tlp.RegisterNumber),
+			"ext_reg_num":  fmt.Sprintf("0x%01x", tlp.ExtRegisterNumber),
+		}, "", tlp.ToBytes(), nil
+	case "IORD":
+		if len(body) < 3*4 {
+			return nil, "", nil, fmt.Errorf("%w: TLP buffer too short (%d), expected at least 12 bytes", pcie.ErrTooShort, len(body))
+		}
+		reqHdr := decodeRequestHeader(body)
+		if reqHdr.Type != pcie.IORdT {
+			return nil, "", nil, fmt.Errorf("%w: type %x is not supported. supported types: IORdT", pcie.ErrBadType, reqHdr.Type)
+		}
+		tlp := &pcie.IORd{
+			RequestHeader: reqHdr,
+			Address:       pcie.Address(binary.BigEndian.Uint32(body[8:12])),
+		}
+		return map[string]interface{}{
+			"requester_id": fmt.Sprintf("0x%04x", tlp.ReqID.ToUint16()),
+			"tag":          tlp.Tag,
+			"address":      fmt.Sprintf("0x%x", tlp.Address),
+			"length":       tlp.DataLength(),
+			"first_be":     fmt.Sprintf("0x%01x", tlp.FirstBE),
+			"last_be":      fmt.Sprintf("0x%01x", tlp.LastBE),
+			"tc":           tlp.TC,
+			"ns":           tlp.NS,
+			"ro":           tlp.RO,
+		}, "", tlp.ToBytes(), nil
+	case "IOWR":
+		if len(body) < 3*4 {
+			return nil, "", nil, fmt.Errorf("%w: TLP buffer too short (%d), expected at least 12 bytes", pcie.ErrTooShort, len(body))
+		}
+		reqHdr := decodeRequestHeader(body)
+		if reqHdr.Type != pcie.IOWrtT {
+			return nil, "", nil, fmt.Errorf("%w: type %x is not supported. supported types: IOWrtT", pcie.ErrBadType, reqHdr.Type)
+		}
+		tlp := &pcie.IOWrt{
+			RequestHeader: reqHdr,
+			Address:       pcie.Address(binary.BigEndian.Uint32(body[8:12])),
+		}
+		tlp.Data = make([]byte, tlp.DataLength())
+		if len(body) < 12+len(tlp.Data) {
+			return nil, "", nil, fmt.Errorf("%w: TLP data too short (%d), expected %d bytes", pcie.ErrTooShort, len(body)-12, len(tlp.Data))
+		}
+		copy(tlp.Data, body[12:12+len(tlp.Data)])
+		return map[string]interface{}{
+			"requester_id": fmt.Sprintf("0x%04x", tlp.ReqID.ToUint16()),
+			"tag":          tlp.Tag,
+			"address":      fmt.Sprintf("0x%x", tlp.Address),
+			"length":       tlp.DataLength(),
+			"first_be":     fmt.Sprintf("0x%01x", tlp.FirstBE),
+			"last_be":      fmt.Sprintf("0x%01x", tlp.LastBE),
+			"tc":           tlp.TC,
+			"ns":           tlp.NS,
+			"ro":           tlp.RO,
+		}, hex.EncodeToString(tlp.Data), tlp.ToBytes(), nil
+	case "CPLLK":
+		if len(body) < 3*4 {
+			return nil, "", nil, fmt.Errorf("%w: TLP buffer too short (%d), expected at least 12 bytes", pcie.ErrTooShort, len(body))
+		}
+		hdr := decodeTlpHeaderDword(body[0:4])
+		if hdr.Type != pcie.CplLk && hdr.Type != pcie.CplLkD {
+			return nil, "", nil, fmt.Errorf("%w: type %x is not supported. supported types: CplLk, CplLkD", pcie.ErrBadType, hdr.Type)
+		}
+		tlp := &pcie.Cpl{CplHeader: pcie.CplHeader{
+			TlpHeader:  hdr,
+			CplID:      pcie.NewDeviceID(binary.BigEndian.Uint16(body[4:6])),
+			Status:     pcie.CompletionStatus((body[6] >> 5) & 0x7),
+			BC:         int(body[6]&0xf)<<8 | int(body[7]),
+			ReqID:      pcie.NewDeviceID(binary.BigEndian.Uint16(body[8:10])),
+			Tag:        body[10],
+			AddressLow: body[11] & 0x7f,
+		}}
+		if hdr.Type == pcie.CplLkD {
+			tlp.Data = make([]byte, tlp.DataLength())
+			if len(body) < 12+len(tlp.Data) {
+				return nil, "", nil, fmt.Errorf("%w: TLP data too short (%d), expected %d bytes", pcie.ErrTooShort, len(body)-12, len(tlp.Data))
+			}
+			copy(tlp.Data, body[12:12+len(tlp.Data)])
+		}
+		return map[string]interface{}{
+			"completer_id":  fmt.Sprintf("0x%04x", tlp.CplID.ToUint16()),
+			"status":        tlp.Status,
+			"requester_id":  fmt.Sprintf("0x%04x", tlp.ReqID.ToUint16()),
+			"tag":           tlp.Tag,
+			"byte_count":    tlp.BC,
+			"lower_address": fmt.Sprintf("0x%02x", tlp.AddressLow),
+			"tc":            tlp.TC,
+		}, hex.EncodeToString(tlp.Data), tlp.ToBytes(), nil
+	default:
+		return nil, "", nil, fmt.Errorf("unknown TLP type %q", t)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/rabidcicada/go-pcie-tlp/pcie"
+)
+
+// TLPSpec is a declarative description of one TLP to encode. It mirrors
+// the CLI's encode flags field-for-field, which lets both the single-shot
+// --encode path and the --pcap JSON manifest path (see pcapcmd.go) share
+// buildTLP instead of duplicating the constructor dispatch.
+type TLPSpec struct {
+	Type         string   `json:"type"`
+	DeviceID     string   `json:"did,omitempty"`
+	Tag          uint8    `json:"tag,omitempty"`
+	Address      string   `json:"addr,omitempty"`
+	Length       uint32   `json:"len,omitempty"`
+	Data         string   `json:"data,omitempty"`
+	TargetID     string   `json:"target,omitempty"`
+	RegisterNum  string   `json:"regnum,omitempty"`
+	CompleterID  string   `json:"creg,omitempty"`
+	Status       uint8    `json:"cplstatus,omitempty"`
+	ByteCount    int      `json:"bytecount,omitempty"`
+	LowerAddress string   `json:"loweraddr,omitempty"`
+	Prefixes     []string `json:"prefixes,omitempty"`
+}
+
+// buildTLP encodes spec into the raw bytes of the TLP it describes, ready
+// to hand to a pcap Writer or to hex-print directly.
+func buildTLP(spec TLPSpec) ([]byte, error) {
+	var did pcie.DeviceID
+	if spec.DeviceID != "" {
+		if err := did.FromString(spec.DeviceID); err != nil {
+			return nil, fmt.Errorf("did: %w", err)
+		}
+	}
+
+	var addr uint64
+	if spec.Address != "" {
+		a, err := parseHexUint(spec.Address, 64)
+		if err != nil {
+			return nil, fmt.Errorf("addr: %w", err)
+		}
+		addr = a
+	}
+
+	data, err := hexDecodeSpaced(spec.Data)
+	if err != nil {
+		return nil, fmt.Errorf("data: %w", err)
+	}
+
+	var tlpBytes []byte
+	switch spec.Type {
+	case "MEMRD":
+		tlp, err := pcie.NewMRd(did, spec.Tag, addr, spec.Length)
+		if err != nil {
+			return nil, err
+		}
+		tlpBytes = tlp.ToBytes()
+	case "MEMWR":
+		tlp, err := pcie.NewMWr(did, spec.Tag, addr, data)
+		if err != nil {
+			return nil, err
+		}
+		tlpBytes = tlp.ToBytes()
+	case "IORD":
+		tlp, err := pcie.NewIORd(did, spec.Tag, addr, spec.Length)
+		if err != nil {
+			return nil, err
+		}
+		tlpBytes = tlp.ToBytes()
+	case "IOWR":
+		tlp, err := pcie.NewIOWrt(did, addr, data)
+		if err != nil {
+			return nil, err
+		}
+		tlpBytes = tlp.ToBytes()
+	case "CFGRD":
+		var target pcie.DeviceID
+		if err := target.FromString(spec.TargetID); err != nil {
+			return nil, fmt.Errorf("target: %w", err)
+		}
+		regnum, err := parseHexUint(spec.RegisterNum, 16)
+		if err != nil {
+			return nil, fmt.Errorf("regnum: %w", err)
+		}
+		tlp := pcie.NewCfgRd(did, spec.Tag, target, int(regnum))
+		tlpBytes = tlp.ToBytes()
+	case "CFGWR":
+		var target pcie.DeviceID
+		if err := target.FromString(spec.TargetID); err != nil {
+			return nil, fmt.Errorf("target: %w", err)
+		}
+		regnum, err := parseHexUint(spec.RegisterNum, 16)
+		if err != nil {
+			return nil, fmt.Errorf("regnum: %w", err)
+		}
+		var cfgData [4]byte
+		copy(cfgData[:], data)
+		tlp := pcie.NewCfgWr(did, spec.Tag, target, int(regnum), cfgData)
+		tlpBytes = tlp.ToBytes()
+	case "CPL":
+		var creg pcie.DeviceID
+		if err := creg.FromString(spec.CompleterID); err != nil {
+			return nil, fmt.Errorf("creg: %w", err)
+		}
+		loweraddr, err := parseHexUint(spec.LowerAddress, 8)
+		if err != nil {
+			return nil, fmt.Errorf("loweraddr: %w", err)
+		}
+		tlp, err := pcie.NewCpl(creg, spec.ByteCount, pcie.CompletionStatus(spec.Status), did, spec.Tag, uint8(loweraddr), data)
+		if err != nil {
+			return nil, err
+		}
+		tlpBytes = tlp.ToBytes()
+	case "CPLLK":
+		// NewCpl/CplHeader only know about CplE/CplD; the pcie package
+		// exposes no separate constructor for locked-read completions.
+		// Build as a normal CPL and override the promoted Type field with
+		// CplLk/CplLkD before encoding, the same Fmt/Type byte CplE/CplD
+		// would have gotten had data been absent/present.
+		var creg pcie.DeviceID
+		if err := creg.FromString(spec.CompleterID); err != nil {
+			return nil, fmt.Errorf("creg: %w", err)
+		}
+		loweraddr, err := parseHexUint(spec.LowerAddress, 8)
+		if err != nil {
+			return nil, fmt.Errorf("loweraddr: %w", err)
+		}
+		tlp, err := pcie.NewCpl(creg, spec.ByteCount, pcie.CompletionStatus(spec.Status), did, spec.Tag, uint8(loweraddr), data)
+		if err != nil {
+			return nil, err
+		}
+		if tlp.Type == pcie.CplD {
+			tlp.Type = pcie.CplLkD
+		} else {
+			tlp.Type = pcie.CplLk
+		}
+		tlpBytes = tlp.ToBytes()
+	default:
+		return nil, fmt.Errorf("unsupported type %q", spec.Type)
+	}
+
+	prefixBytes, err := encodePrefixes(spec.Prefixes)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(prefixBytes, tlpBytes...), nil
+}
+
+// parseHexUint parses a non-0x-prefixed hexadecimal string into a uint of
+// the given bit size. An empty string parses as 0, matching the CLI's
+// existing handling of unset optional fields.
+func parseHexUint(s string, bitSize int) (uint64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(s, 16, bitSize)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// outputFormats are the values accepted by --output.
+var outputFormats = []string{"text", "json", "yaml"}
+
+// streamFramings are the values accepted by --framing.
+var streamFramings = []string{"newline", "length"}
+
+// emitDecoded renders a decoded TLP (and any errors accumulated while
+// trying to decode it) to w in the requested format.
+func emitDecoded(w io.Writer, rec *DecodedTLP, errs []error, format string) error {
+	switch format {
+	case "json":
+		if rec == nil {
+			return fmt.Errorf("no TLP type matched: %w", firstOrNil(errs))
+		}
+		enc := json.NewEncoder(w)
+		return enc.Encode(rec)
+	case "yaml":
+		if rec == nil {
+			return fmt.Errorf("no TLP type matched: %w", firstOrNil(errs))
+		}
+		b, err := yaml.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(b, []byte("---\n")...))
+		return err
+	default:
+		if rec == nil {
+			for _, err := range errs {
+				fmt.Fprintln(w, err.Error())
+			}
+			return fmt.Errorf("no TLP type matched")
+		}
+		if rec.Timestamp != nil {
+			fmt.Fprintf(w, "[%s] ", rec.Timestamp.Format(time.RFC3339Nano))
+		}
+		fmt.Fprintf(w, "Valid %s Packet:%s\n", rec.Type, rec.RawBytes)
+		for _, p := range rec.Prefixes {
+			fmt.Fprintf(w, "  prefix %s:\n", p.Kind)
+			keys := make([]string, 0, len(p.Fields))
+			for k := range p.Fields {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				fmt.Fprintf(w, "    %s: %v\n", k, p.Fields[k])
+			}
+		}
+		keys := make([]string, 0, len(rec.Fields))
+		for k := range rec.Fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(w, "  %s: %v\n", k, rec.Fields[k])
+		}
+		if rec.Payload != "" {
+			fmt.Fprintf(w, "  payload: %s\n", rec.Payload)
+		}
+		return nil
+	}
+}
+
+func firstOrNil(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs[0]
+}
+
+// runStream reads a sequence of TLPs from r in the given framing and writes
+// one decoded record per TLP to os.Stdout in format, so the tool can sit in
+// the middle of a shell pipeline the way other protocol decoders do.
+func runStream(r io.Reader, types []string, format string, framing string) error {
+	switch framing {
+	case "length":
+		return runStreamLengthDelimited(r, types, format)
+	default:
+		return runStreamNewlineDelimited(r, types, format)
+	}
+}
+
+// runStreamNewlineDelimited reads one hex-encoded TLP per line from r (blank
+// lines and '#' comments are skipped).
+func runStreamNewlineDelimited(r io.Reader, types []string, format string) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		raw, err := hexDecodeSpaced(line)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "stream: skipping malformed line: %v\n", err)
+			continue
+		}
+
+		rec, errs := decodeTLP(raw, types)
+		if err := emitDecoded(os.Stdout, rec, errs, format); err != nil {
+			fmt.Fprintf(os.Stderr, "stream: %v\n", err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// runStreamLengthDelimited reads a sequence of raw (not hex-encoded) TLPs
+// from r, each framed as a 4-byte big-endian length prefix followed by that
+// many bytes of TLP. This is the framing a binary capture pipeline (as
+// opposed to a text log of hex strings) would actually use.
+func runStreamLengthDelimited(r io.Reader, types []string, format string) error {
+	br := bufio.NewReader(r)
+
+	for {
+		var length uint32
+		if err := binary.Read(br, binary.BigEndian, &length); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("stream: reading frame length: %w", err)
+		}
+
+		raw := make([]byte, length)
+		if _, err := io.ReadFull(br, raw); err != nil {
+			return fmt.Errorf("stream: reading %d-byte frame: %w", length, err)
+		}
+
+		rec, errs := decodeTLP(raw, types)
+		if err := emitDecoded(os.Stdout, rec, errs, format); err != nil {
+			fmt.Fprintf(os.Stderr, "stream: %v\n", err)
+		}
+	}
+}
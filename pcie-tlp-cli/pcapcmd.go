@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rabidcicada/go-pcie-tlp-cli/pcap"
+)
+
+// runPcapDecode reads every frame out of the pcap/pcapng capture at path,
+// runs each one through the same dispatcher decodeTLP uses for a single
+// --bytes value, and emits one structured record per frame with the
+// capture's timestamp attached.
+func runPcapDecode(path string, types []string, format string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("pcap: %w", err)
+	}
+	defer f.Close()
+
+	r, err := pcap.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("pcap: %w", err)
+	}
+
+	for {
+		frame, err := r.ReadFrame()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("pcap: %w", err)
+		}
+
+		rec, errs := decodeTLP(frame.Data, types)
+		if rec != nil {
+			ts := frame.Timestamp
+			rec.Timestamp = &ts
+		}
+		if err := emitDecoded(os.Stdout, rec, errs, format); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+}
+
+// runPcapEncode writes one frame per spec to a new pcap/pcapng capture at
+// path, in the requested container format and link type.
+func runPcapEncode(path string, format pcap.Format, linkType pcap.LinkType, specs []TLPSpec) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("pcap: %w", err)
+	}
+	defer f.Close()
+
+	w, err := pcap.NewWriter(f, format, linkType)
+	if err != nil {
+		return fmt.Errorf("pcap: %w", err)
+	}
+	defer w.Close()
+
+	for i, spec := range specs {
+		raw, err := buildTLP(spec)
+		if err != nil {
+			return fmt.Errorf("pcap: spec %d (%s): %w", i, spec.Type, err)
+		}
+		if err := w.WriteFrame(pcap.Frame{Timestamp: time.Now(), Data: raw}); err != nil {
+			return fmt.Errorf("pcap: writing frame %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// readManifest parses a JSON manifest of TLP specs, the format accepted by
+// --pcap's write mode when --manifest is given instead of a single set of
+// encode flags.
+func readManifest(path string) ([]TLPSpec, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("manifest: %w", err)
+	}
+
+	var specs []TLPSpec
+	if err := json.Unmarshal(b, &specs); err != nil {
+		return nil, fmt.Errorf("manifest: %w", err)
+	}
+	return specs, nil
+}
@@ -3,12 +3,12 @@ package main
 import (
 	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
-	"strconv"
 	"strings"
 
 	"github.com/akamensky/argparse"
-	"github.com/rabidcicada/go-pcie-tlp/pcie"
+	"github.com/rabidcicada/go-pcie-tlp-cli/pcap"
 )
 
 const (
@@ -16,7 +16,6 @@ const (
 	fmt4DWNoData   = 0b001
 	fmt3DWWithData = 0b010
 	fmt4DWWithData = 0b011
-	fmtTlpPrefix   = 0b100
 )
 
 // TlpType is the format and type field in the TLP header.
@@ -55,50 +54,34 @@ const (
 	// CplD is a Completion with Data. Used for Memory,
 	// I/O, and Configuration Read Completions.
 	CplD TlpType = (fmt3DWWithData << 5) | 0b01010
-	// CplLk is a Completion for Locked Memory Read without
-	// Data. Used only in error case.
-	CplLk TlpType = (fmt3DWNoData << 5) | 0b01011
-	// CplLkD is a Completion for Locked Memory Read –
-	// otherwise like CplD.
-	CplLkD TlpType = (fmt3DWWithData << 5) | 0b01011
-	// MRIOV is a Multi-Root I/O Virtualization and Sharing (MR-IOV) TLP prefix.
-	MRIOV TlpType = (fmtTlpPrefix << 5) | 0b00000
-	// LocalVendPrefix is a Local TLP prefix with vendor sub-field.
-	LocalVendPrefix TlpType = (fmtTlpPrefix << 5) | 0b01110
-	// ExtTPH is an Extended TPH TLP prefix.
-	ExtTPH TlpType = (fmtTlpPrefix << 5) | 0b10000
-	// PASID is a Process Address Space ID (PASID) TLP Prefix.
-	PASID TlpType = (fmtTlpPrefix << 5) | 0b10001
-	// EndEndVendPrefix is an End-to-End TLP prefix with vendor sub-field.
-	EndEndVendPrefix TlpType = (fmtTlpPrefix << 5) | 0b11110
 )
 
+// hexDecodeSpaced decodes a hex string that may contain spaces between
+// byte pairs, the format every --bytes/--data/stream input in this tool
+// accepts.
+func hexDecodeSpaced(s string) ([]byte, error) {
+	return hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+}
+
 func printfmttypes() {
-	fmt.Printf("MRd3 % x\n", MRd3);
-	fmt.Printf("MRd4 % x\n", MRd4);
-	fmt.Printf("MRdLk3 % x\n", MRdLk3);
-	fmt.Printf("MRdLk4 % x\n", MRdLk4);
-	fmt.Printf("MWr3 % x\n", MWr3);
-	fmt.Printf("MWr4 % x\n", MWr4);
-	fmt.Printf("IORdT % x\n", IORdT);
-	fmt.Printf("IOWrtT % x\n", IOWrtT);
-	fmt.Printf("CfgRd0 % x\n", CfgRd0);
-	fmt.Printf("CfgWr0 % x\n", CfgWr0);
-	fmt.Printf("CfgRd1 % x\n", CfgRd1);
-	fmt.Printf("CfgWr1 % x\n", CfgWr1);
-	fmt.Printf("CplE % x\n", CplE);
-	fmt.Printf("CplD % x\n", CplD);
-	fmt.Printf("CplLk % x\n", CplLk);
-	fmt.Printf("CplLkD % x\n", CplLkD);
-	fmt.Printf("MRIOV % x\n", MRIOV);
-	fmt.Printf("LocalVendPrefix % x\n", LocalVendPrefix);
-	fmt.Printf("ExtTPH % x\n", ExtTPH);
-	fmt.Printf("PASID % x\n", PASID);
-	fmt.Printf("EndEndVendPrefix % x\n", EndEndVendPrefix);
+	fmt.Printf("MRd3 % x\n", MRd3)
+	fmt.Printf("MRd4 % x\n", MRd4)
+	fmt.Printf("MRdLk3 % x\n", MRdLk3)
+	fmt.Printf("MRdLk4 % x\n", MRdLk4)
+	fmt.Printf("MWr3 % x\n", MWr3)
+	fmt.Printf("MWr4 % x\n", MWr4)
+	fmt.Printf("IORdT % x\n", IORdT)
+	fmt.Printf("IOWrtT % x\n", IOWrtT)
+	fmt.Printf("CfgRd0 % x\n", CfgRd0)
+	fmt.Printf("CfgWr0 % x\n", CfgWr0)
+	fmt.Printf("CfgRd1 % x\n", CfgRd1)
+	fmt.Printf("CfgWr1 % x\n", CfgWr1)
+	fmt.Printf("CplE % x\n", CplE)
+	fmt.Printf("CplD % x\n", CplD)
 }
 
 func main() {
-	all_tlp_types := []string{"MEMRD", "MEMWR", "CPL", "CFGWR"}
+	all_tlp_types := []string{"MEMRD", "MEMWR", "CPL", "CPLLK", "CFGRD", "CFGWR", "IORD", "IOWR"}
 	// Create new parser object
 	parser := argparse.NewParser("tlp-encode-decode", "encodes or decodes tlps")
 
@@ -114,7 +97,34 @@ func main() {
 	var device_id_str *string = parser.String("", "did", &argparse.Options{Required: false, Help: "Device ID in form of '<busnum>:<devicenum>:<funcnum>'"})
 	tag := parser.Int("", "tag", &argparse.Options{Required: false, Help: "uint8_t tag number"})
 	addr_str := parser.String("", "addr", &argparse.Options{Required: false, Help: "Non-0x-prefixed hexadecimal address"})
-	length := parser.Int("", "len", &argparse.Options{Required: false, Help: "number of bytes for the transaction (MemRd/MemWr)"})
+	length := parser.Int("", "len", &argparse.Options{Required: false, Help: "number of bytes for the transaction (MemRd/IORd; MemWr takes its length from --data)"})
+
+	// Config space TLP args
+	target_id_str := parser.String("", "target", &argparse.Options{Required: false, Help: "Target Device ID in form of '<busnum>:<devicenum>:<funcnum>' (CfgRd/CfgWr)"})
+	regnum_str := parser.String("", "regnum", &argparse.Options{Required: false, Help: "Non-0x-prefixed hexadecimal config space register number (CfgRd/CfgWr)"})
+
+	// Completion TLP args
+	completer_id_str := parser.String("", "creg", &argparse.Options{Required: false, Help: "Completer Device ID in form of '<busnum>:<devicenum>:<funcnum>' (CPL)"})
+	cpl_status := parser.Int("", "cplstatus", &argparse.Options{Required: false, Help: "3-bit Completion Status (CPL)"})
+	bytecount := parser.Int("", "bytecount", &argparse.Options{Required: false, Help: "12-bit byte count remaining (CPL)"})
+	loweraddr_str := parser.String("", "loweraddr", &argparse.Options{Required: false, Help: "Non-0x-prefixed hexadecimal lower address bits (CPL)"})
+
+	// Repeatable TLP prefixes, prepended to the emitted TLP in the order given.
+	prefix_specs := parser.StringList("", "prefix", &argparse.Options{Required: false, Help: "TLP prefix to prepend, as <kind>:<field>=<value>,...; kind is one of pasid (id,exec,priv), mriov (vh), exttph (st), localvendor (data), endendvendor (data). Repeatable."})
+
+	output_format := parser.Selector("", "output", outputFormats, &argparse.Options{Required: false, Help: "Decode output format"})
+	stream := parser.Flag("", "stream", &argparse.Options{Required: false, Help: "Decode a sequence of TLPs from stdin (or --infile) instead of a single --bytes value; see --framing"})
+	stream_framing := parser.Selector("", "framing", streamFramings, &argparse.Options{Required: false, Help: "--stream input framing: newline-delimited hex text (default), or length-delimited raw bytes"})
+	infile := parser.String("", "infile", &argparse.Options{Required: false, Help: "Read --stream input from this path instead of stdin"})
+
+	pcap_path := parser.String("", "pcap", &argparse.Options{Required: false, Help: "Decode every frame in this pcap/pcapng capture, or (with --encode) write one to it"})
+	pcap_manifest := parser.String("", "manifest", &argparse.Options{Required: false, Help: "JSON array of TLP specs to batch into the --pcap capture, instead of the single TLP described by the other encode flags"})
+	pcap_ng := parser.Flag("", "pcapng", &argparse.Options{Required: false, Help: "Write the --pcap capture as pcapng instead of classic pcap"})
+	pcap_linktype := parser.Int("", "linktype", &argparse.Options{Required: false, Help: "DLT_* link type to tag the --pcap capture with (default 147, DLT_USER0)"})
+
+	fuzz := parser.Flag("", "fuzz", &argparse.Options{Required: false, Help: "Round-trip random-but-valid TLPs of every type through encode/decode and report any mismatches"})
+	fuzz_iterations := parser.Int("", "iterations", &argparse.Options{Required: false, Help: "Number of --fuzz iterations to run (default 1000)"})
+	fuzz_corpus_dir := parser.String("", "corpus-dir", &argparse.Options{Required: false, Help: "Directory --fuzz saves failing inputs to (default testvectors/corpus)"})
 
 	// Parse input
 	err := parser.Parse(os.Args)
@@ -125,124 +135,127 @@ func main() {
 		os.Exit(1)
 	}
 	if *printtypes {
-		printfmttypes();
+		printfmttypes()
 		return
 	}
 
-	var tlp_raw_bytes []byte
-	var data_raw_bytes []byte
-
-	var addr uint64
-	var did pcie.DeviceID
+	if *fuzz {
+		iterations := *fuzz_iterations
+		if iterations == 0 {
+			iterations = 1000
+		}
+		corpusDir := *fuzz_corpus_dir
+		if corpusDir == "" {
+			corpusDir = "testvectors/corpus"
+		}
+		if err := runFuzz(iterations, corpusDir); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	// Parse req args
-	if *encode {
+	spec := TLPSpec{
+		Type:         *tlp_type,
+		DeviceID:     *device_id_str,
+		Tag:          uint8(*tag),
+		Address:      *addr_str,
+		Length:       uint32(*length),
+		Data:         *data_raw_bytes_str,
+		TargetID:     *target_id_str,
+		RegisterNum:  *regnum_str,
+		CompleterID:  *completer_id_str,
+		Status:       uint8(*cpl_status),
+		ByteCount:    *bytecount,
+		LowerAddress: *loweraddr_str,
+		Prefixes:     *prefix_specs,
+	}
 
-		switch *tlp_type {
-		case "MEMWR":
-			spaceless_data_raw_bytes_str := strings.ReplaceAll(*data_raw_bytes_str, " ", "")
+	if *pcap_path != "" {
+		format := *output_format
+		if format == "" {
+			format = "text"
+		}
 
-			data_raw_bytes, err = hex.DecodeString(spaceless_data_raw_bytes_str)
-			if err != nil {
+		if *encode {
+			specs := []TLPSpec{spec}
+			if *pcap_manifest != "" {
+				m, err := readManifest(*pcap_manifest)
+				if err != nil {
+					panic(err)
+				}
+				specs = m
+			}
 
-				panic(err)
+			containerFormat := pcap.FormatPcap
+			if *pcap_ng {
+				containerFormat = pcap.FormatPcapNG
 			}
-			fallthrough
-		case "MEMRD":
-			err := did.FromString(*device_id_str)
-			if err != nil {
+			linkType := pcap.LinkTypeUSER0
+			if *pcap_linktype != 0 {
+				linkType = pcap.LinkType(*pcap_linktype)
+			}
+			if err := runPcapEncode(*pcap_path, containerFormat, linkType, specs); err != nil {
 				panic(err)
 			}
-			addr, err = strconv.ParseUint(*addr_str, 16, 64)
-			if err != nil {
-
+		} else {
+			types := all_tlp_types
+			if *tlp_type != "" {
+				types = []string{*tlp_type}
+			}
+			if err := runPcapDecode(*pcap_path, types, format); err != nil {
 				panic(err)
 			}
-		default:
-			panic("Unsupported type specified")
 		}
-	} else {
-		fmt.Print("Parsing Decode Args\n")
-		spaceless_tlp_raw_bytes_str := strings.ReplaceAll(*tlp_raw_bytes_str, " ", "")
+		return
+	}
 
-		tlp_raw_bytes, err = hex.DecodeString(spaceless_tlp_raw_bytes_str)
+	if *encode {
+		raw, err := buildTLP(spec)
 		if err != nil {
-
 			panic(err)
 		}
+		fmt.Print(hex.EncodeToString(raw))
+		return
+	}
 
+	format := *output_format
+	if format == "" {
+		format = "text"
 	}
 
-	if *encode {
-		// Dispatch into encoders/creators
-		switch *tlp_type {
-		case "MEMRD":
-			tlp, err := pcie.NewMRd(did, uint8(*tag), addr, uint32(*length))
-			if err != nil {
-				panic(err)
-			}
-			fmt.Print(hex.EncodeToString(tlp.ToBytes()))
-		case "MEMWR":
-			tlp, err := pcie.NewMWr(did, addr, data_raw_bytes)
+	types := all_tlp_types
+	if *tlp_type != "" {
+		types = []string{*tlp_type}
+	}
+
+	if *stream {
+		var in io.Reader = os.Stdin
+		if *infile != "" {
+			f, err := os.Open(*infile)
 			if err != nil {
 				panic(err)
 			}
-			fmt.Printf("Did: 0x%04x\n", did.ToUint16())
-			fmt.Printf("tag: 0x%02x\n", uint8(*tag))
-			fmt.Print(hex.EncodeToString(tlp.ToBytes()))
-			fmt.Printf("\nMWr3 as uint8==>%02x\n",uint8(MWr3))
-			fmt.Printf("\nMWr4 as uint8==>%02x\n",uint8(MWr4))
-		default:
-			panic("Unsupported type specified")
+			defer f.Close()
+			in = f
 		}
-	} else {
-
-		// Dispatch into parsers
-		if *tlp_type == "" {
-			try_decode(tlp_raw_bytes, all_tlp_types...)
-		}else{
-			try_decode(tlp_raw_bytes, *tlp_type)
+		framing := *stream_framing
+		if framing == "" {
+			framing = "newline"
 		}
-
-	}
-}
-
-func try_decode( tlp_raw_bytes []byte,  types ...string) {
-	errs := []error{}
-
-	for _,t := range types {
-		switch t {
-		case "MEMRD":
-			tlp, err := pcie.NewMRdFromBytes(tlp_raw_bytes)
-			if err != nil {
-				errs = append(errs,fmt.Errorf("MEMRD: %w",err))
-				continue
-			}
-			fmt.Print("Valid MEMRD Packet:" + hex.EncodeToString(tlp.ToBytes())+"\n")
-			return
-		case "MEMWR":
-			tlp, err := pcie.NewMWrFromBytes(tlp_raw_bytes)
-			if err != nil {
-				errs = append(errs,fmt.Errorf("MEMWR: %w",err))
-				continue
-			}
-
-			fmt.Print("Valid MEMWR Packet:" + hex.EncodeToString(tlp.ToBytes())+"\n")
-			return
-		case "CPL":
-			tlp, err := pcie.NewCplFromBytes(tlp_raw_bytes)
-			if err != nil {
-				errs = append(errs,fmt.Errorf("CPL: %w",err))
-				continue
-			}
-
-			fmt.Print("Valid CPL Packet:" + hex.EncodeToString(tlp.ToBytes())+"\n")
-			return
+		if err := runStream(in, types, format, framing); err != nil {
+			panic(err)
 		}
-		
+		return
 	}
-	for _,err := range errs {
-		fmt.Println(err.Error())
+
+	tlp_raw_bytes, err := hexDecodeSpaced(*tlp_raw_bytes_str)
+	if err != nil {
+		panic(err)
 	}
 
-}
\ No newline at end of file
+	rec, errs := decodeTLP(tlp_raw_bytes, types)
+	if err := emitDecoded(os.Stdout, rec, errs, format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rabidcicada/go-pcie-tlp/pcie"
+)
+
+// The pcie package enumerates every TLP prefix's Fmt/Type byte (MRIOV,
+// LocalVendPrefix, ExtTPH, PASID, EndEndVendPrefix) but, unlike the TLPs
+// themselves, has no struct type or constructor for the 3 prefix-specific
+// bytes that follow it -- prefixes are self-contained dwords whose bit
+// layout comes straight from the spec, independent of what the library
+// exposes. This file hand-packs/parses those bytes the same way
+// pcap/ng.go hand-packs its block/option bytes instead of going through a
+// library type.
+
+// prefixFmtMask isolates the 3-bit Fmt field (bits 7:5) every TlpType byte,
+// prefix or otherwise, starts with. A prefix's Fmt field is always 0b100.
+const prefixFmtMask = 0b111_00000
+const prefixFmt = 0b100_00000
+
+// isPrefixByte reports whether b is the first byte of a TLP prefix dword
+// rather than the start of a TLP header.
+func isPrefixByte(b byte) bool {
+	return b&prefixFmtMask == prefixFmt
+}
+
+// DecodedPrefix is one parsed TLP prefix in a chain walked off the front of
+// a raw TLP.
+type DecodedPrefix struct {
+	Kind   string                 `json:"kind" yaml:"kind"`
+	Fields map[string]interface{} `json:"fields" yaml:"fields"`
+}
+
+// decodePrefixChain strips and decodes every TLP prefix dword off the front
+// of raw, stopping at the first dword whose Fmt field isn't the prefix
+// Fmt (i.e. the start of the TLP proper).
+func decodePrefixChain(raw []byte) ([]DecodedPrefix, []byte, error) {
+	var prefixes []DecodedPrefix
+
+	for len(raw) >= 4 && isPrefixByte(raw[0]) {
+		p, err := decodePrefix(raw[:4])
+		if err != nil {
+			return nil, nil, err
+		}
+		prefixes = append(prefixes, p)
+		raw = raw[4:]
+	}
+
+	return prefixes, raw, nil
+}
+
+func decodePrefix(dword []byte) (DecodedPrefix, error) {
+	typ := pcie.TlpType(dword[0])
+
+	switch typ {
+	case pcie.PASID:
+		b1, b2, b3 := dword[1], dword[2], dword[3]
+		pasid := uint32(b1&0x0f)<<16 | uint32(b2)<<8 | uint32(b3)
+		return DecodedPrefix{
+			Kind: "pasid",
+			Fields: map[string]interface{}{
+				"exec": b1&0x20 != 0,
+				"priv": b1&0x10 != 0,
+				"id":   fmt.Sprintf("0x%05x", pasid),
+			},
+		}, nil
+	case pcie.MRIOV:
+		return DecodedPrefix{
+			Kind: "mriov",
+			Fields: map[string]interface{}{
+				"vh": fmt.Sprintf("0x%02x", dword[3]),
+			},
+		}, nil
+	case pcie.ExtTPH:
+		st := uint16(dword[2])<<8 | uint16(dword[3])
+		return DecodedPrefix{
+			Kind: "exttph",
+			Fields: map[string]interface{}{
+				"st": fmt.Sprintf("0x%04x", st),
+			},
+		}, nil
+	case pcie.LocalVendPrefix:
+		return DecodedPrefix{Kind: "localvendor", Fields: map[string]interface{}{"data": fmt.Sprintf("% x", dword[1:])}}, nil
+	case pcie.EndEndVendPrefix:
+		return DecodedPrefix{Kind: "endendvendor", Fields: map[string]interface{}{"data": fmt.Sprintf("% x", dword[1:])}}, nil
+	default:
+		return DecodedPrefix{}, fmt.Errorf("unknown TLP prefix type %#02x", byte(typ))
+	}
+}
+
+// encodePrefixes packs one --prefix flag value per spec into its raw dword,
+// in order, ready to prepend to an encoded TLP. Each spec has the form
+// "<kind>:<field>=<value>[,<field>=<value>...]"; supported kinds are pasid,
+// mriov, exttph, localvendor, and endendvendor.
+func encodePrefixes(specs []string) ([]byte, error) {
+	var out []byte
+	for _, spec := range specs {
+		dword, err := encodePrefix(spec)
+		if err != nil {
+			return nil, fmt.Errorf("prefix %q: %w", spec, err)
+		}
+		out = append(out, dword...)
+	}
+	return out, nil
+}
+
+func encodePrefix(spec string) ([]byte, error) {
+	kind, rest, ok := strings.Cut(spec, ":")
+	if !ok {
+		return nil, fmt.Errorf("expected <kind>:<fields>")
+	}
+	fields, err := parsePrefixFields(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(kind) {
+	case "pasid":
+		id, err := fields.hexUint("id", 20)
+		if err != nil {
+			return nil, err
+		}
+		exec, err := fields.boolField("exec")
+		if err != nil {
+			return nil, err
+		}
+		priv, err := fields.boolField("priv")
+		if err != nil {
+			return nil, err
+		}
+		var b1 byte
+		if exec {
+			b1 |= 0x20
+		}
+		if priv {
+			b1 |= 0x10
+		}
+		b1 |= byte(id>>16) & 0x0f
+		return []byte{byte(pcie.PASID), b1, byte(id >> 8), byte(id)}, nil
+	case "mriov":
+		vh, err := fields.hexUint("vh", 8)
+		if err != nil {
+			return nil, err
+		}
+		return []byte{byte(pcie.MRIOV), 0, 0, byte(vh)}, nil
+	case "exttph":
+		st, err := fields.hexUint("st", 16)
+		if err != nil {
+			return nil, err
+		}
+		return []byte{byte(pcie.ExtTPH), 0, byte(st >> 8), byte(st)}, nil
+	case "localvendor", "endendvendor":
+		data, err := fields.bytesField("data", 3)
+		if err != nil {
+			return nil, err
+		}
+		typ := pcie.LocalVendPrefix
+		if strings.ToLower(kind) == "endendvendor" {
+			typ = pcie.EndEndVendPrefix
+		}
+		return append([]byte{byte(typ)}, data...), nil
+	default:
+		return nil, fmt.Errorf("unknown prefix kind %q", kind)
+	}
+}
+
+// prefixFields is a parsed "key=val,key=val" --prefix field list.
+type prefixFields map[string]string
+
+func parsePrefixFields(s string) (prefixFields, error) {
+	fields := prefixFields{}
+	if s == "" {
+		return fields, nil
+	}
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected key=value, got %q", kv)
+		}
+		fields[k] = v
+	}
+	return fields, nil
+}
+
+func (f prefixFields) hexUint(key string, bits int) (uint64, error) {
+	v, ok := f[key]
+	if !ok {
+		return 0, fmt.Errorf("missing required field %q", key)
+	}
+	n, err := strconv.ParseUint(v, 16, bits)
+	if err != nil {
+		return 0, fmt.Errorf("field %q: %w", key, err)
+	}
+	return n, nil
+}
+
+func (f prefixFields) boolField(key string) (bool, error) {
+	v, ok := f[key]
+	if !ok {
+		return false, nil
+	}
+	switch v {
+	case "1":
+		return true, nil
+	case "0":
+		return false, nil
+	default:
+		return false, fmt.Errorf("field %q: expected 0 or 1, got %q", key, v)
+	}
+}
+
+func (f prefixFields) bytesField(key string, wantLen int) ([]byte, error) {
+	v, ok := f[key]
+	if !ok {
+		return nil, fmt.Errorf("missing required field %q", key)
+	}
+	b, err := hexDecodeSpaced(v)
+	if err != nil {
+		return nil, fmt.Errorf("field %q: %w", key, err)
+	}
+	if len(b) != wantLen {
+		return nil, fmt.Errorf("field %q: expected %d bytes, got %d", key, wantLen, len(b))
+	}
+	return b, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestPrefixRoundTrip encodes one --prefix spec per kind and checks that
+// decoding the resulting dword reproduces the same kind and fields.
+func TestPrefixRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		want DecodedPrefix
+	}{
+		{
+			name: "pasid",
+			spec: "pasid:id=abcde,exec=1,priv=0",
+			want: DecodedPrefix{
+				Kind: "pasid",
+				Fields: map[string]interface{}{
+					"id":   "0xabcde",
+					"exec": true,
+					"priv": false,
+				},
+			},
+		},
+		{
+			name: "mriov",
+			spec: "mriov:vh=2a",
+			want: DecodedPrefix{
+				Kind:   "mriov",
+				Fields: map[string]interface{}{"vh": "0x2a"},
+			},
+		},
+		{
+			name: "exttph",
+			spec: "exttph:st=1234",
+			want: DecodedPrefix{
+				Kind:   "exttph",
+				Fields: map[string]interface{}{"st": "0x1234"},
+			},
+		},
+		{
+			name: "localvendor",
+			spec: "localvendor:data=aabbcc",
+			want: DecodedPrefix{
+				Kind:   "localvendor",
+				Fields: map[string]interface{}{"data": "aa bb cc"},
+			},
+		},
+		{
+			name: "endendvendor",
+			spec: "endendvendor:data=112233",
+			want: DecodedPrefix{
+				Kind:   "endendvendor",
+				Fields: map[string]interface{}{"data": "11 22 33"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			dword, err := encodePrefix(tt.spec)
+			if err != nil {
+				t.Fatalf("encodePrefix(%q): %v", tt.spec, err)
+			}
+			if len(dword) != 4 {
+				t.Fatalf("encodePrefix(%q): got %d bytes, want 4", tt.spec, len(dword))
+			}
+			if !isPrefixByte(dword[0]) {
+				t.Fatalf("encodePrefix(%q): first byte %#02x is not a prefix byte", tt.spec, dword[0])
+			}
+
+			got, err := decodePrefix(dword)
+			if err != nil {
+				t.Fatalf("decodePrefix(% x): %v", dword, err)
+			}
+			if got.Kind != tt.want.Kind {
+				t.Fatalf("decodePrefix(% x): kind = %q, want %q", dword, got.Kind, tt.want.Kind)
+			}
+			for k, want := range tt.want.Fields {
+				if got.Fields[k] != want {
+					t.Fatalf("decodePrefix(% x): field %q = %v, want %v", dword, k, got.Fields[k], want)
+				}
+			}
+		})
+	}
+}
+
+// TestPrefixChainRoundTrip checks that decodePrefixChain strips a chain of
+// several prefixes off the front of a TLP and leaves the TLP body intact.
+func TestPrefixChainRoundTrip(t *testing.T) {
+	body := []byte{0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00}
+
+	prefixBytes, err := encodePrefixes([]string{"mriov:vh=01", "exttph:st=0002"})
+	if err != nil {
+		t.Fatalf("encodePrefixes: %v", err)
+	}
+
+	raw := append(append([]byte{}, prefixBytes...), body...)
+
+	prefixes, rest, err := decodePrefixChain(raw)
+	if err != nil {
+		t.Fatalf("decodePrefixChain: %v", err)
+	}
+	if len(prefixes) != 2 {
+		t.Fatalf("decodePrefixChain: got %d prefixes, want 2", len(prefixes))
+	}
+	if prefixes[0].Kind != "mriov" || prefixes[1].Kind != "exttph" {
+		t.Fatalf("decodePrefixChain: kinds = %q, %q, want mriov, exttph", prefixes[0].Kind, prefixes[1].Kind)
+	}
+	if !bytes.Equal(rest, body) {
+		t.Fatalf("decodePrefixChain: rest = % x, want % x", rest, body)
+	}
+}
@@ -0,0 +1,213 @@
+package testvectors
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rabidcicada/go-pcie-tlp/pcie"
+)
+
+// corpusDir is where SaveFailure persists failing --fuzz inputs, relative
+// to this package's directory (the default --corpus-dir, "testvectors/corpus",
+// is the same path relative to the repo root).
+const corpusDir = "corpus"
+
+// TestRoundTrip generates a batch of random-but-valid TLPs of every type
+// Generate supports and checks that ToBytes -> NewXxxFromBytes -> ToBytes
+// reproduces the original encoding exactly.
+func TestRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for _, typ := range AllTypes {
+		typ := typ
+		t.Run(typ, func(t *testing.T) {
+			for i := 0; i < 50; i++ {
+				if err := RoundTrip(r, typ); err != nil {
+					t.Fatalf("iteration %d: %v", i, err)
+				}
+			}
+		})
+	}
+}
+
+// TestSeedCorpus checks every hand-written vector in SeedCorpus decodes
+// and re-encodes to itself.
+func TestSeedCorpus(t *testing.T) {
+	for _, v := range SeedCorpus {
+		v := v
+		t.Run(v.Type, func(t *testing.T) {
+			raw, err := hex.DecodeString(v.Hex)
+			if err != nil {
+				t.Fatalf("bad seed hex: %v", err)
+			}
+			got, err := Decode(v.Type, raw)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if !bytes.Equal(raw, got) {
+				t.Fatalf("re-encoding mismatch: want %s, got %s", v.Hex, hex.EncodeToString(got))
+			}
+		})
+	}
+}
+
+// seedHexFor returns every known-good seed for typ: the hand-written
+// entries in SeedCorpus, plus any failing input a prior --fuzz run
+// captured into corpusDir via SaveFailure, so a captured failure actually
+// becomes a regression case instead of an inert file nothing reads.
+func seedHexFor(typ string) [][]byte {
+	var out [][]byte
+	for _, v := range SeedCorpus {
+		if v.Type != typ {
+			continue
+		}
+		if b, err := hex.DecodeString(v.Hex); err == nil {
+			out = append(out, b)
+		}
+	}
+	out = append(out, loadCorpusFailures(typ)...)
+	return out
+}
+
+// loadCorpusFailures reads back every "<typ>-*.hex" file SaveFailure wrote
+// to corpusDir, in the single-hex-line-per-file format SaveFailure uses.
+// A missing corpusDir (no failures captured yet) is not an error.
+func loadCorpusFailures(typ string) [][]byte {
+	entries, err := os.ReadDir(corpusDir)
+	if err != nil {
+		return nil
+	}
+
+	var out [][]byte
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), typ+"-") {
+			continue
+		}
+		line, err := os.ReadFile(filepath.Join(corpusDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		b, err := hex.DecodeString(strings.TrimSpace(string(line)))
+		if err != nil {
+			continue
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// idempotentDecode is the invariant FuzzNewMRdFromBytes etc. check:
+// arbitrary fuzzer input may not decode back to itself byte-for-byte (it
+// may carry trailing garbage beyond the header, or BE padding the decoder
+// normalizes), but once it has been canonicalized by one decode+ToBytes
+// pass, decoding that canonical form again must be a fixed point.
+func idempotentDecode(t *testing.T, data []byte, decode func([]byte) ([]byte, error)) {
+	once, err := decode(data)
+	if err != nil {
+		return
+	}
+	twice, err := decode(once)
+	if err != nil {
+		t.Fatalf("canonical encoding failed to re-decode: %v", err)
+	}
+	if !bytes.Equal(once, twice) {
+		t.Fatalf("decode not idempotent: once=%s twice=%s", hex.EncodeToString(once), hex.EncodeToString(twice))
+	}
+}
+
+func FuzzNewMRdFromBytes(f *testing.F) {
+	for _, b := range seedHexFor("MEMRD") {
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		idempotentDecode(t, data, func(b []byte) ([]byte, error) {
+			tlp, err := pcie.NewMRdFromBytes(b)
+			if err != nil {
+				return nil, err
+			}
+			return tlp.ToBytes(), nil
+		})
+	})
+}
+
+func FuzzNewMWrFromBytes(f *testing.F) {
+	for _, b := range seedHexFor("MEMWR") {
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		idempotentDecode(t, data, func(b []byte) ([]byte, error) {
+			tlp, err := pcie.NewMWrFromBytes(b)
+			if err != nil {
+				return nil, err
+			}
+			return tlp.ToBytes(), nil
+		})
+	})
+}
+
+func FuzzNewCplFromBytes(f *testing.F) {
+	for _, b := range seedHexFor("CPL") {
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		idempotentDecode(t, data, func(b []byte) ([]byte, error) {
+			tlp, err := pcie.NewCplFromBytes(b)
+			if err != nil {
+				return nil, err
+			}
+			return tlp.ToBytes(), nil
+		})
+	})
+}
+
+// FuzzDecodeIORD, FuzzDecodeIOWR, FuzzDecodeCFGRD, and FuzzDecodeCPLLK fuzz
+// the types Decode hand-decodes instead of going through a pcie.NewXxxFromBytes
+// parser, since the pcie package exposes no FromBytes constructor for them.
+func FuzzDecodeIORD(f *testing.F) {
+	for _, b := range seedHexFor("IORD") {
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		idempotentDecode(t, data, func(b []byte) ([]byte, error) {
+			return Decode("IORD", b)
+		})
+	})
+}
+
+func FuzzDecodeIOWR(f *testing.F) {
+	for _, b := range seedHexFor("IOWR") {
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		idempotentDecode(t, data, func(b []byte) ([]byte, error) {
+			return Decode("IOWR", b)
+		})
+	})
+}
+
+func FuzzDecodeCFGRD(f *testing.F) {
+	for _, b := range seedHexFor("CFGRD") {
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		idempotentDecode(t, data, func(b []byte) ([]byte, error) {
+			return Decode("CFGRD", b)
+		})
+	})
+}
+
+func FuzzDecodeCPLLK(f *testing.F) {
+	for _, b := range seedHexFor("CPLLK") {
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		idempotentDecode(t, data, func(b []byte) ([]byte, error) {
+			return Decode("CPLLK", b)
+		})
+	})
+}